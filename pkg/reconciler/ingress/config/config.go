@@ -0,0 +1,150 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config holds the configuration parsed out of the config-istio
+// ConfigMap that drives the net-istio ingress reconciler.
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// IstioConfigName is the name of the configmap containing all
+	// customizations for ingress-istio-controller.
+	IstioConfigName = "config-istio"
+
+	// gatewaysKeyPrefix is the prefix of all keys to configure Istio gateways for public Ingresses.
+	gatewaysKeyPrefix = "gateway."
+
+	// localGatewaysKeyPrefix is the prefix of all keys to configure Istio gateways for cluster-local Ingresses.
+	localGatewaysKeyPrefix = "local-gateway."
+
+	// secretDeliveryModeKey selects how TLS Secrets referenced by an
+	// Ingress get delivered to the Istio gateway.
+	secretDeliveryModeKey = "secret-delivery-mode"
+
+	// caSecretNameKey names the default Secret holding the CA trust
+	// bundle used for mTLS origination.
+	caSecretNameKey = "ca-secret-name"
+
+	// caConfigMapNameKey names the default ConfigMap holding the CA trust
+	// bundle used for mTLS origination.
+	caConfigMapNameKey = "ca-configmap-name"
+)
+
+// SecretDeliveryMode controls how TLS Secrets referenced by an Ingress get
+// delivered to the Istio gateway.
+type SecretDeliveryMode string
+
+const (
+	// SecretDeliveryModeCopy duplicates every referenced Secret into the
+	// gateway's namespace and has the Gateway's Server reference the copy
+	// by name. This is the default, and how net-istio has always worked.
+	SecretDeliveryModeCopy SecretDeliveryMode = "copy"
+
+	// SecretDeliveryModeSDS leaves the Secret in its source namespace and
+	// has the Gateway's Server reference it directly through Istio's SDS
+	// credentialName lookup, avoiding the copy (and its GC) entirely.
+	SecretDeliveryModeSDS SecretDeliveryMode = "sds"
+)
+
+// Gateway specifies the name of the Gateway and the K8s Service backing it.
+type Gateway struct {
+	Name       string
+	ServiceURL string
+}
+
+// Istio contains the configuration for the Istio ingress reconciler, found
+// in the config-istio config map.
+type Istio struct {
+	// IngressGateways specifies the gateway urls for public Ingresses.
+	IngressGateways []Gateway
+
+	// LocalGateways specifies the gateway urls for cluster-local Ingresses.
+	LocalGateways []Gateway
+
+	// SecretDeliveryMode selects how TLS Secrets referenced by an Ingress
+	// get delivered to the Istio gateway. Defaults to
+	// SecretDeliveryModeCopy when unset.
+	SecretDeliveryMode SecretDeliveryMode
+
+	// CASecretName is the default Secret (in the Ingress's namespace)
+	// holding the CA trust bundle used for mTLS origination, letting
+	// operators rotate the CA independently of any leaf certificate. Can
+	// be overridden per-Ingress; see resources.CABundleSecretAnnotationKey.
+	CASecretName string
+
+	// CAConfigMapName is the ConfigMap equivalent of CASecretName. If
+	// both are set, CASecretName takes precedence.
+	CAConfigMapName string
+}
+
+// NewIstioFromConfigMap creates an Istio config from the supplied ConfigMap.
+func NewIstioFromConfigMap(configMap *corev1.ConfigMap) (*Istio, error) {
+	istio := &Istio{SecretDeliveryMode: SecretDeliveryModeCopy}
+	for k, v := range configMap.Data {
+		switch {
+		case strings.HasPrefix(k, gatewaysKeyPrefix):
+			gw, err := parseGateway(strings.TrimPrefix(k, gatewaysKeyPrefix), v)
+			if err != nil {
+				return nil, err
+			}
+			istio.IngressGateways = append(istio.IngressGateways, *gw)
+		case strings.HasPrefix(k, localGatewaysKeyPrefix):
+			gw, err := parseGateway(strings.TrimPrefix(k, localGatewaysKeyPrefix), v)
+			if err != nil {
+				return nil, err
+			}
+			istio.LocalGateways = append(istio.LocalGateways, *gw)
+		case k == secretDeliveryModeKey:
+			mode, err := parseSecretDeliveryMode(v)
+			if err != nil {
+				return nil, err
+			}
+			istio.SecretDeliveryMode = mode
+		case k == caSecretNameKey:
+			istio.CASecretName = v
+		case k == caConfigMapNameKey:
+			istio.CAConfigMapName = v
+		}
+	}
+	return istio, nil
+}
+
+func parseGateway(name, serviceURL string) (*Gateway, error) {
+	if serviceURL == "" {
+		return nil, fmt.Errorf("failed to parse the IngressGateway and LocalGateway from %q", name)
+	}
+	return &Gateway{Name: name, ServiceURL: serviceURL}, nil
+}
+
+func parseSecretDeliveryMode(v string) (SecretDeliveryMode, error) {
+	switch mode := SecretDeliveryMode(v); mode {
+	case SecretDeliveryModeCopy, SecretDeliveryModeSDS:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("failed to parse %s: %q must be %q or %q", secretDeliveryModeKey, v, SecretDeliveryModeCopy, SecretDeliveryModeSDS)
+	}
+}
+
+// Config contains the configuration defined by the running environment.
+type Config struct {
+	Istio *Istio
+}
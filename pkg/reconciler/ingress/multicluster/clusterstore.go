@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package multicluster keeps track of the remote clusters that net-istio's
+// ingress reconciler should fan resources out to, modeled after Admiral's
+// remote-cluster secret controller: one kubeconfig Secret per cluster,
+// labeled with ClusterRegistryLabelKey, living in the controller's own
+// namespace.
+package multicluster
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ClusterRegistryLabelKey marks a Secret in the controller's own
+	// namespace as holding the kubeconfig for a remote cluster.
+	ClusterRegistryLabelKey = "networking.knative.dev/cluster-registry"
+
+	// KubeconfigSecretKey is the key within the registered Secret's Data
+	// holding the kubeconfig for the remote cluster.
+	KubeconfigSecretKey = "kubeconfig"
+)
+
+// RemoteCluster holds everything the ingress reconciler needs in order to
+// talk to a single remote cluster.
+type RemoteCluster struct {
+	// Name identifies the cluster, and is the name of the Secret that
+	// registered it.
+	Name string
+
+	// Client is a Kubernetes client scoped to the remote cluster.
+	Client kubernetes.Interface
+
+	// InformerFactory is the shared informer factory backing Client,
+	// kept around so its informers (and their stop channel) can be torn
+	// down cleanly when the cluster is unregistered.
+	InformerFactory informers.SharedInformerFactory
+
+	stopCh chan struct{}
+}
+
+// NewRemoteCluster returns a RemoteCluster ready to be registered with a
+// Store, with its own stop channel wired up so Store.Remove can tear it
+// down cleanly.
+func NewRemoteCluster(name string, client kubernetes.Interface, factory informers.SharedInformerFactory) *RemoteCluster {
+	return &RemoteCluster{
+		Name:            name,
+		Client:          client,
+		InformerFactory: factory,
+		stopCh:          make(chan struct{}),
+	}
+}
+
+// Store is a concurrency-safe registry of the remote clusters known to the
+// ingress reconciler.
+type Store struct {
+	mu       sync.RWMutex
+	clusters map[string]*RemoteCluster
+}
+
+// NewStore returns an empty Store.
+func NewStore() *Store {
+	return &Store{clusters: make(map[string]*RemoteCluster)}
+}
+
+var global = NewStore()
+
+// Get returns the process-wide Store that the cluster secret controller
+// populates and the ingress reconciler reads from.
+func Get() *Store {
+	return global
+}
+
+// Add registers (or replaces) a remote cluster.
+func (s *Store) Add(rc *RemoteCluster) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.clusters[rc.Name]; ok {
+		close(old.stopCh)
+	}
+	s.clusters[rc.Name] = rc
+}
+
+// Remove tears down and unregisters the named remote cluster, if present.
+func (s *Store) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rc, ok := s.clusters[name]; ok {
+		close(rc.stopCh)
+		delete(s.clusters, name)
+	}
+}
+
+// Cluster returns the named remote cluster, if it is registered.
+func (s *Store) Cluster(name string) (*RemoteCluster, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rc, ok := s.clusters[name]
+	return rc, ok
+}
+
+// Clusters returns the names of every currently registered remote cluster.
+func (s *Store) Clusters() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.clusters))
+	for name := range s.clusters {
+		names = append(names, name)
+	}
+	return names
+}
+
+type storeKey struct{}
+
+// FromContext extracts the Store from the context, the same way
+// config.FromContext extracts a *config.Config. Returns nil if ctx carries
+// none, which callers should treat as "use the process-wide Get() Store";
+// in this repo only tests call ToContext.
+func FromContext(ctx context.Context) *Store {
+	x, ok := ctx.Value(storeKey{}).(*Store)
+	if ok {
+		return x
+	}
+	return nil
+}
+
+// ToContext attaches the provided Store to the provided context, returning
+// the new context with the Store attached.
+func ToContext(ctx context.Context, s *Store) context.Context {
+	return context.WithValue(ctx, storeKey{}, s)
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"testing"
+)
+
+func TestStoreAddRemove(t *testing.T) {
+	s := NewStore()
+
+	if got := s.Clusters(); len(got) != 0 {
+		t.Fatalf("Clusters() = %v, want empty", got)
+	}
+
+	rc := &RemoteCluster{Name: "cluster-1", stopCh: make(chan struct{})}
+	s.Add(rc)
+
+	if got, ok := s.Cluster("cluster-1"); !ok || got != rc {
+		t.Fatalf("Cluster(%q) = %v, %v, want %v, true", "cluster-1", got, ok, rc)
+	}
+	if got := s.Clusters(); len(got) != 1 || got[0] != "cluster-1" {
+		t.Fatalf("Clusters() = %v, want [cluster-1]", got)
+	}
+
+	s.Remove("cluster-1")
+	if _, ok := s.Cluster("cluster-1"); ok {
+		t.Fatal("Cluster(\"cluster-1\") still present after Remove")
+	}
+}
+
+func TestStoreAddReplacesExisting(t *testing.T) {
+	s := NewStore()
+
+	first := &RemoteCluster{Name: "cluster-1", stopCh: make(chan struct{})}
+	s.Add(first)
+
+	second := &RemoteCluster{Name: "cluster-1", stopCh: make(chan struct{})}
+	s.Add(second)
+
+	got, ok := s.Cluster("cluster-1")
+	if !ok || got != second {
+		t.Fatalf("Cluster(%q) = %v, %v, want %v, true", "cluster-1", got, ok, second)
+	}
+	select {
+	case <-first.stopCh:
+	default:
+		t.Fatal("expected replaced RemoteCluster's stopCh to be closed")
+	}
+}
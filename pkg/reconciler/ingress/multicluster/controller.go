@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	secretinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/secret"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/system"
+)
+
+// NewController watches Secrets labeled with ClusterRegistryLabelKey in the
+// controller's own namespace, and registers/refreshes/tears down a remote
+// Kubernetes client and Secret informer in the global Store for each one.
+//
+// It does not reconcile application state itself, so unlike most net-istio
+// controllers it is not built on top of a generated reconciler: it simply
+// reacts to informer events, the same way Admiral's remote-cluster secret
+// controller does.
+func NewController(ctx context.Context) *controller.Impl {
+	logger := logging.FromContext(ctx)
+	secrets := secretinformer.Get(ctx)
+
+	impl := controller.NewImplFull(&reconciler{logger: logger}, controller.ControllerOptions{
+		WorkQueueName: "ClusterRegistrySecrets",
+		Logger:        logger,
+	})
+
+	secrets.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			handleClusterRegistrySecret(logger, obj, registerCluster)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			handleClusterRegistrySecret(logger, obj, registerCluster)
+		},
+		DeleteFunc: func(obj interface{}) {
+			handleClusterRegistrySecret(logger, obj, func(secret *corev1.Secret) error {
+				UnregisterCluster(secret)
+				return nil
+			})
+		},
+	})
+
+	return impl
+}
+
+// handleClusterRegistrySecret unwraps a possible
+// cache.DeletedFinalStateUnknown tombstone (which the informer hands Delete
+// handlers when it misses the actual deletion event), filters for Secrets
+// that are actually cluster-registry entries, and invokes fn on them.
+func handleClusterRegistrySecret(logger *zap.SugaredLogger, obj interface{}, fn func(*corev1.Secret) error) {
+	secret, ok := asClusterRegistrySecret(obj)
+	if !ok {
+		return
+	}
+	if err := fn(secret); err != nil {
+		logger.Errorw("Failed to handle cluster registry secret", "secret", secret.Name, "error", err)
+	}
+}
+
+func asClusterRegistrySecret(obj interface{}) (*corev1.Secret, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil, false
+	}
+	return secret, secret.Namespace == system.Namespace() && secret.Labels[ClusterRegistryLabelKey] == "true"
+}
+
+// reconciler only exists so that NewController can plug into the shared
+// controller.Impl plumbing (leader election, workqueue metrics, shutdown);
+// registration happens synchronously in the event handler above, so there
+// is nothing left to do per work item.
+type reconciler struct {
+	logger *zap.SugaredLogger
+}
+
+func (r *reconciler) Reconcile(ctx context.Context, key string) error {
+	return nil
+}
+
+// registerCluster builds a Kubernetes client and Secret informer for the
+// cluster described by secret, and adds it to the global Store, replacing
+// (and tearing down) any previous registration under the same name.
+func registerCluster(secret *corev1.Secret) error {
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(secret.Data[KubeconfigSecretKey])
+	if err != nil {
+		return err
+	}
+
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	factory := informers.NewSharedInformerFactory(client, 10*time.Hour)
+	// Pre-warm the Secret informer used by the ingress reconciler to
+	// look up and clean up the copies it creates in this cluster.
+	factory.Core().V1().Secrets().Informer()
+
+	rc := NewRemoteCluster(secret.Name, client, factory)
+	factory.Start(rc.stopCh)
+	Get().Add(rc)
+	return nil
+}
+
+// UnregisterCluster removes the remote cluster that was registered under
+// the given Secret's name, tearing down its client and informers.
+func UnregisterCluster(secret *corev1.Secret) {
+	Get().Remove(secret.Name)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/system"
+
+	_ "knative.dev/pkg/system/testing"
+)
+
+func TestAsClusterRegistrySecret(t *testing.T) {
+	clusterSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster-1",
+			Namespace: system.Namespace(),
+			Labels:    map[string]string{ClusterRegistryLabelKey: "true"},
+		},
+	}
+	otherSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "not-a-cluster-secret", Namespace: system.Namespace()},
+	}
+
+	cases := []struct {
+		name   string
+		obj    interface{}
+		wantOk bool
+	}{{
+		name:   "plain cluster-registry Secret",
+		obj:    clusterSecret,
+		wantOk: true,
+	}, {
+		name:   "tombstone wrapping a cluster-registry Secret",
+		obj:    cache.DeletedFinalStateUnknown{Key: "knative-serving/cluster-1", Obj: clusterSecret},
+		wantOk: true,
+	}, {
+		name:   "unrelated Secret",
+		obj:    otherSecret,
+		wantOk: false,
+	}, {
+		name:   "tombstone wrapping an unrelated object",
+		obj:    cache.DeletedFinalStateUnknown{Key: "knative-serving/other", Obj: otherSecret},
+		wantOk: false,
+	}, {
+		name:   "neither a Secret nor a tombstone",
+		obj:    "not-a-secret",
+		wantOk: false,
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			secret, ok := asClusterRegistrySecret(c.obj)
+			if ok != c.wantOk {
+				t.Fatalf("asClusterRegistrySecret() ok = %v, want %v", ok, c.wantOk)
+			}
+			if ok && secret.Name != "cluster-1" {
+				t.Errorf("asClusterRegistrySecret() = %v, want cluster-1", secret.Name)
+			}
+		})
+	}
+}
+
+func TestHandleClusterRegistrySecretCallsFnOnlyForMatches(t *testing.T) {
+	clusterSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster-1",
+			Namespace: system.Namespace(),
+			Labels:    map[string]string{ClusterRegistryLabelKey: "true"},
+		},
+	}
+
+	var called bool
+	handleClusterRegistrySecret(nil, clusterSecret, func(*corev1.Secret) error {
+		called = true
+		return nil
+	})
+	if !called {
+		t.Error("expected fn to be called for a matching Secret")
+	}
+
+	called = false
+	handleClusterRegistrySecret(nil, "not-a-secret", func(*corev1.Secret) error {
+		called = true
+		return nil
+	})
+	if called {
+		t.Error("expected fn not to be called for a non-Secret object")
+	}
+}
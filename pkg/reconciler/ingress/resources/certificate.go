@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"knative.dev/pkg/kmeta"
+	"knative.dev/serving/pkg/apis/networking/v1alpha1"
+	certlisters "knative.dev/serving/pkg/client/listers/networking/v1alpha1"
+)
+
+const (
+	// AutoTLSAnnotationKey opts a single Ingress into auto-provisioning of
+	// any Secret its TLS blocks reference but that doesn't exist yet.
+	AutoTLSAnnotationKey = "networking.knative.dev/auto-tls"
+
+	// enabledValue is the only value of AutoTLSAnnotationKey that turns
+	// auto-TLS on.
+	enabledValue = "enabled"
+)
+
+// CertificateNotReadyError indicates that the Certificate backing a TLS
+// block exists but hasn't reported a ready Secret yet. Callers should
+// requeue and try again once the Certificate's status changes.
+type CertificateNotReadyError struct {
+	Name string
+}
+
+func (e *CertificateNotReadyError) Error() string {
+	return fmt.Sprintf("Certificate %q is not ready yet", e.Name)
+}
+
+// CertificateFailedError indicates that the Certificate backing a TLS block
+// failed to provision and will not become ready on its own.
+type CertificateFailedError struct {
+	Name   string
+	Reason string
+}
+
+func (e *CertificateFailedError) Error() string {
+	return fmt.Sprintf("Certificate %q failed: %s", e.Name, e.Reason)
+}
+
+// IsAutoTLSEnabled reports whether ing opted into auto-TLS, either through
+// its own annotation or the cluster-wide default.
+func IsAutoTLSEnabled(ing *v1alpha1.Ingress, clusterDefault bool) bool {
+	if v, ok := ing.Annotations[AutoTLSAnnotationKey]; ok {
+		return v == enabledValue
+	}
+	return clusterDefault
+}
+
+// MakeCertificates creates the Certificate that should back each of ing's
+// TLS blocks, named after the Secret it is responsible for populating so
+// that GetCertificateSecret can find it again on the next reconciliation.
+// Callers should only invoke this for an Ingress where IsAutoTLSEnabled
+// is true; it is up to the ingress reconciler's controller (not part of
+// this package) to create the returned Certificates and to watch a
+// Certificate informer so that a status change requeues the Ingress,
+// the same way it already watches Secrets.
+func MakeCertificates(ing *v1alpha1.Ingress) []*v1alpha1.Certificate {
+	certs := make([]*v1alpha1.Certificate, 0, len(ing.Spec.TLS))
+	for _, tls := range ing.Spec.TLS {
+		certs = append(certs, &v1alpha1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            certificateName(tls),
+				Namespace:       tls.SecretNamespace,
+				OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(ing)},
+			},
+			Spec: v1alpha1.CertificateSpec{
+				DNSNames:   tls.Hosts,
+				SecretName: tls.SecretName,
+			},
+		})
+	}
+	return certs
+}
+
+func certificateName(tls v1alpha1.IngressTLS) string {
+	return tls.SecretName
+}
+
+// GetCertificateSecret resolves the Secret backing tls's auto-provisioned
+// Certificate (mirroring what knative/serving's certificate reconciler does
+// for cluster-local Ingresses). The reconciler is responsible for creating
+// the Certificate itself, via MakeCertificates, before calling this; if it
+// hasn't been created yet this returns *CertificateNotReadyError the same
+// as if it exists but isn't ready. Once the Certificate's Ready condition
+// goes true this returns the Secret it populated; if Ready goes false with
+// no chance of recovering it returns *CertificateFailedError.
+func GetCertificateSecret(tls v1alpha1.IngressTLS, secretLister corelisters.SecretLister, certLister certlisters.CertificateLister) (*corev1.Secret, error) {
+	cert, err := certLister.Certificates(tls.SecretNamespace).Get(certificateName(tls))
+	if apierrs.IsNotFound(err) {
+		return nil, &CertificateNotReadyError{Name: certificateName(tls)}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get Certificate %s/%s: %w", tls.SecretNamespace, certificateName(tls), err)
+	}
+
+	ready := cert.Status.GetCondition(v1alpha1.CertificateConditionReady)
+	switch {
+	case ready == nil || ready.IsUnknown():
+		return nil, &CertificateNotReadyError{Name: cert.Name}
+	case ready.IsFalse():
+		return nil, &CertificateFailedError{Name: cert.Name, Reason: ready.Message}
+	}
+
+	return secretLister.Secrets(tls.SecretNamespace).Get(cert.Spec.SecretName)
+}
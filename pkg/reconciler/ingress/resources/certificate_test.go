@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakek8s "k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/serving/pkg/apis/networking/v1alpha1"
+	fakeservingclient "knative.dev/serving/pkg/client/clientset/versioned/fake"
+	servinginformers "knative.dev/serving/pkg/client/informers/externalversions"
+)
+
+var testTLS = v1alpha1.IngressTLS{
+	Hosts:           []string{"example.com"},
+	SecretName:      "example-com",
+	SecretNamespace: "knative-serving",
+}
+
+func TestMakeCertificates(t *testing.T) {
+	ing := &v1alpha1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "ingress", Namespace: "knative-serving"},
+		Spec:       v1alpha1.IngressSpec{TLS: []v1alpha1.IngressTLS{testTLS}},
+	}
+	got := MakeCertificates(ing)
+	if len(got) != 1 {
+		t.Fatalf("MakeCertificates() returned %d certs, want 1", len(got))
+	}
+	if got[0].Name != "example-com" || got[0].Namespace != "knative-serving" {
+		t.Errorf("MakeCertificates()[0] = %s/%s, want knative-serving/example-com", got[0].Namespace, got[0].Name)
+	}
+	if diff := cmp.Diff([]string{"example.com"}, got[0].Spec.DNSNames); diff != "" {
+		t.Errorf("Unexpected DNSNames (-want, +got): %s", diff)
+	}
+}
+
+func certStatusWithReady(status apis.ConditionStatus, reason, message string) v1alpha1.CertificateStatus {
+	return v1alpha1.CertificateStatus{
+		Status: duckv1.Status{
+			Conditions: duckv1.Conditions{{
+				Type:    v1alpha1.CertificateConditionReady,
+				Status:  status,
+				Reason:  reason,
+				Message: message,
+			}},
+		},
+	}
+}
+
+func TestGetCertificateSecret(t *testing.T) {
+	readyCert := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-com", Namespace: "knative-serving"},
+		Spec:       v1alpha1.CertificateSpec{DNSNames: []string{"example.com"}, SecretName: "example-com"},
+		Status:     certStatusWithReady(apis.ConditionTrue, "", ""),
+	}
+	pendingCert := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "pending-com", Namespace: "knative-serving"},
+		Spec:       v1alpha1.CertificateSpec{DNSNames: []string{"pending.com"}, SecretName: "pending-com"},
+		Status:     certStatusWithReady(apis.ConditionUnknown, "Provisioning", "still provisioning"),
+	}
+	failedCert := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "failed-com", Namespace: "knative-serving"},
+		Spec:       v1alpha1.CertificateSpec{DNSNames: []string{"failed.com"}, SecretName: "failed-com"},
+		Status:     certStatusWithReady(apis.ConditionFalse, "CertificateFailed", "the CA rejected the request"),
+	}
+
+	kubeClient := fakek8s.NewSimpleClientset()
+	kubeFactory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	secretClient := kubeFactory.Core().V1().Secrets()
+	secretClient.Informer().GetIndexer().Add(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-com", Namespace: "knative-serving"},
+	})
+
+	servingClient := fakeservingclient.NewSimpleClientset()
+	servingFactory := servinginformers.NewSharedInformerFactory(servingClient, 0)
+	certClient := servingFactory.Networking().V1alpha1().Certificates()
+	certClient.Informer().GetIndexer().Add(readyCert)
+	certClient.Informer().GetIndexer().Add(pendingCert)
+	certClient.Informer().GetIndexer().Add(failedCert)
+
+	cases := []struct {
+		name      string
+		tls       v1alpha1.IngressTLS
+		wantErrAs interface{}
+	}{{
+		name:      "no Certificate yet",
+		tls:       v1alpha1.IngressTLS{SecretName: "no-such-cert", SecretNamespace: "knative-serving"},
+		wantErrAs: &CertificateNotReadyError{},
+	}, {
+		name:      "Certificate still provisioning",
+		tls:       v1alpha1.IngressTLS{SecretName: "pending-com", SecretNamespace: "knative-serving"},
+		wantErrAs: &CertificateNotReadyError{},
+	}, {
+		name:      "Certificate failed",
+		tls:       v1alpha1.IngressTLS{SecretName: "failed-com", SecretNamespace: "knative-serving"},
+		wantErrAs: &CertificateFailedError{},
+	}, {
+		name: "Certificate ready",
+		tls:  v1alpha1.IngressTLS{SecretName: "example-com", SecretNamespace: "knative-serving"},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			secret, err := GetCertificateSecret(c.tls, secretClient.Lister(), certClient.Lister())
+			if c.wantErrAs != nil {
+				if err == nil {
+					t.Fatal("GetCertificateSecret() = nil error, want one")
+				}
+				switch c.wantErrAs.(type) {
+				case *CertificateNotReadyError:
+					var target *CertificateNotReadyError
+					if !errors.As(err, &target) {
+						t.Errorf("GetCertificateSecret() error = %v, want *CertificateNotReadyError", err)
+					}
+				case *CertificateFailedError:
+					var target *CertificateFailedError
+					if !errors.As(err, &target) {
+						t.Errorf("GetCertificateSecret() error = %v, want *CertificateFailedError", err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetCertificateSecret() = %v", err)
+			}
+			if secret.Name != "example-com" {
+				t.Errorf("GetCertificateSecret() = %s, want example-com", secret.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+
+	"istio.io/api/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/net-istio/pkg/reconciler/ingress/config"
+	"knative.dev/serving/pkg/apis/networking/v1alpha1"
+)
+
+// MakeTLSServers creates the Istio Servers that terminate TLS for the hosts
+// covered by ing's TLS blocks. Under config.SecretDeliveryModeCopy, the
+// Server's credentialName is the name of the Secret MakeSecrets copied into
+// the gateway's own namespace, or the origin Secret's own name when it
+// already lives there (MakeSecrets makes no copy of it); under
+// config.SecretDeliveryModeSDS it
+// references the origin Secret directly, so istiod can resolve it via SDS
+// without net-istio ever copying it.
+//
+// Servers are built against networking.istio.io/v1beta1, which the
+// Gateway/VirtualService/DestinationRule informers are wired to read and
+// write alongside v1alpha3 during the rollout of that CRD version.
+//
+// When caCert is non-empty (see GetTrustBundle), the Server is switched to
+// MUTUAL mode so the gateway validates client certs against a CA that is
+// rotated independently of the leaf certificate referenced by
+// credentialName. The bundle itself is never written to the Server's
+// caCertificates field, since Istio treats that as a path on the gateway
+// proxy's filesystem, not inline PEM data; instead, under
+// SecretDeliveryModeCopy, MakeSecrets merges it into each copy that
+// credentialName references (see caSecretDataKey), which is the generic
+// Secret format Istio's SDS agent expects; an origin Secret that already
+// lives in the gateway's namespace is not copied and gets no CA merged in. SecretDeliveryModeSDS
+// references the origin Secret directly, which net-istio doesn't own and so
+// can't safely merge a CA into, so a trust bundle under that mode is
+// rejected outright rather than silently ignored.
+//
+// wildcardSecrets identifies which of originSecrets back a wildcard host
+// (see CategorizeSecrets): under SecretDeliveryModeCopy, those get their
+// credentialName built with targetWildcardSecretName instead of
+// TargetSecret, matching the naming MakeWildcardSecrets actually copies
+// them under.
+func MakeTLSServers(ing *v1alpha1.Ingress, gatewayServiceNamespace string, mode config.SecretDeliveryMode, originSecrets, wildcardSecrets map[string]*corev1.Secret, caCert []byte) ([]*v1beta1.Server, error) {
+	servers := make([]*v1beta1.Server, 0, len(ing.Spec.TLS))
+	for _, tls := range ing.Spec.TLS {
+		key := fmt.Sprintf("%s/%s", tls.SecretNamespace, tls.SecretName)
+		origin, ok := originSecrets[key]
+		if !ok {
+			return nil, fmt.Errorf("no origin Secret found for %s/%s", tls.SecretNamespace, tls.SecretName)
+		}
+
+		var credentialName string
+		switch {
+		case mode == config.SecretDeliveryModeSDS:
+			credentialName = crossNamespaceCredentialName(origin)
+		case origin.Namespace == gatewayServiceNamespace:
+			credentialName = origin.Name
+		case wildcardSecrets[key] != nil:
+			credentialName = targetWildcardSecretName(origin.Name, origin.Namespace)
+		default:
+			credentialName = TargetSecret(origin, ing)
+		}
+
+		tlsSettings := &v1beta1.ServerTLSSettings{
+			Mode:           v1beta1.ServerTLSSettings_SIMPLE,
+			CredentialName: credentialName,
+		}
+		if len(caCert) > 0 {
+			if mode == config.SecretDeliveryModeSDS {
+				return nil, fmt.Errorf("trust bundle is not supported under SecretDeliveryModeSDS: the origin Secret %s/%s is not net-istio's to modify, so a CA cannot be merged into it safely; use SecretDeliveryModeCopy instead", tls.SecretNamespace, tls.SecretName)
+			}
+			tlsSettings.Mode = v1beta1.ServerTLSSettings_MUTUAL
+		}
+
+		servers = append(servers, &v1beta1.Server{
+			Hosts: tls.Hosts,
+			Port: &v1beta1.Port{
+				Name:     "https",
+				Number:   443,
+				Protocol: "HTTPS",
+			},
+			Tls: tlsSettings,
+		})
+	}
+	return servers, nil
+}
+
+// crossNamespaceCredentialName formats a Secret reference so istiod can
+// resolve it via PILOT_ENABLE_CROSS_NAMESPACE_CREDENTIAL_LOOKUP, which
+// expects "<namespace>/<name>" rather than a bare Secret name.
+func crossNamespaceCredentialName(secret *corev1.Secret) string {
+	return fmt.Sprintf("%s/%s", secret.Namespace, secret.Name)
+}
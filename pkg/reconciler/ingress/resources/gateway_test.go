@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"istio.io/api/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/net-istio/pkg/reconciler/ingress/config"
+	"knative.dev/serving/pkg/apis/networking/v1alpha1"
+)
+
+func TestMakeTLSServers(t *testing.T) {
+	originSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "secret0",
+			Namespace: "knative-serving",
+			UID:       "1234",
+		},
+	}
+	originSecrets := map[string]*corev1.Secret{
+		"knative-serving/secret0": originSecret,
+	}
+
+	wildcardOriginSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "wildcard-secret",
+			Namespace: "knative-serving",
+			UID:       "5678",
+		},
+	}
+	wildcardIngress := &v1alpha1.Ingress{
+		Spec: v1alpha1.IngressSpec{
+			TLS: []v1alpha1.IngressTLS{{
+				Hosts:           []string{"*.example.com"},
+				SecretName:      "wildcard-secret",
+				SecretNamespace: "knative-serving",
+			}},
+		},
+	}
+	wildcardOriginSecrets := map[string]*corev1.Secret{
+		"knative-serving/wildcard-secret": wildcardOriginSecret,
+	}
+
+	cases := []struct {
+		name            string
+		ing             *v1alpha1.Ingress
+		mode            config.SecretDeliveryMode
+		originSecrets   map[string]*corev1.Secret
+		wildcardSecrets map[string]*corev1.Secret
+		caCert          []byte
+		expected        []*v1beta1.Server
+		wantErr         bool
+	}{{
+		name: "copy mode references the copied Secret in the gateway namespace",
+		mode: config.SecretDeliveryModeCopy,
+		expected: []*v1beta1.Server{{
+			Hosts: []string{"example.com"},
+			Port: &v1beta1.Port{
+				Name:     "https",
+				Number:   443,
+				Protocol: "HTTPS",
+			},
+			Tls: &v1beta1.ServerTLSSettings{
+				Mode:           v1beta1.ServerTLSSettings_SIMPLE,
+				CredentialName: "ingress-1234",
+			},
+		}},
+	}, {
+		name: "sds mode references the origin Secret directly",
+		mode: config.SecretDeliveryModeSDS,
+		expected: []*v1beta1.Server{{
+			Hosts: []string{"example.com"},
+			Port: &v1beta1.Port{
+				Name:     "https",
+				Number:   443,
+				Protocol: "HTTPS",
+			},
+			Tls: &v1beta1.ServerTLSSettings{
+				Mode:           v1beta1.ServerTLSSettings_SIMPLE,
+				CredentialName: "knative-serving/secret0",
+			},
+		}},
+	}, {
+		name:   "a trust bundle switches the Server to MUTUAL mode",
+		mode:   config.SecretDeliveryModeCopy,
+		caCert: []byte("fake-ca-cert-pem"),
+		expected: []*v1beta1.Server{{
+			Hosts: []string{"example.com"},
+			Port: &v1beta1.Port{
+				Name:     "https",
+				Number:   443,
+				Protocol: "HTTPS",
+			},
+			Tls: &v1beta1.ServerTLSSettings{
+				Mode:           v1beta1.ServerTLSSettings_MUTUAL,
+				CredentialName: "ingress-1234",
+			},
+		}},
+	}, {
+		name:    "a trust bundle is rejected under SDS delivery mode",
+		mode:    config.SecretDeliveryModeSDS,
+		caCert:  []byte("fake-ca-cert-pem"),
+		wantErr: true,
+	}, {
+		name:            "copy mode references the wildcard-named copy for a wildcard-categorized origin Secret",
+		ing:             wildcardIngress,
+		mode:            config.SecretDeliveryModeCopy,
+		originSecrets:   wildcardOriginSecrets,
+		wildcardSecrets: wildcardOriginSecrets,
+		expected: []*v1beta1.Server{{
+			Hosts: []string{"*.example.com"},
+			Port: &v1beta1.Port{
+				Name:     "https",
+				Number:   443,
+				Protocol: "HTTPS",
+			},
+			Tls: &v1beta1.ServerTLSSettings{
+				Mode:           v1beta1.ServerTLSSettings_SIMPLE,
+				CredentialName: targetWildcardSecretName("wildcard-secret", "knative-serving"),
+			},
+		}},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ing := c.ing
+			if ing == nil {
+				ing = &ci
+			}
+			secrets := c.originSecrets
+			if secrets == nil {
+				secrets = originSecrets
+			}
+			got, err := MakeTLSServers(ing, "istio-system", c.mode, secrets, c.wildcardSecrets, c.caCert)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("MakeTLSServers() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if c.wantErr {
+				return
+			}
+			if diff := cmp.Diff(c.expected, got, protocmp.Transform()); diff != "" {
+				t.Errorf("Unexpected servers (-want, +got): %s", diff)
+			}
+		})
+	}
+}
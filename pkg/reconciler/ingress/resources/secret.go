@@ -0,0 +1,285 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package resources contains the generators for the various underlying
+// Istio resources that back a Knative Ingress.
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"knative.dev/net-istio/pkg/reconciler/ingress/config"
+	"knative.dev/net-istio/pkg/reconciler/ingress/multicluster"
+	"knative.dev/serving/pkg/apis/networking"
+	"knative.dev/serving/pkg/apis/networking/v1alpha1"
+	certlisters "knative.dev/serving/pkg/client/listers/networking/v1alpha1"
+)
+
+// LocalCluster is the map key MakeSecrets/MakeWildcardSecrets use for the
+// secrets that belong in the namespace of the local Istio gateway, as
+// opposed to the secrets that get fanned out to remote clusters.
+const LocalCluster = ""
+
+// GetSecrets returns the Secrets referenced by the given Ingress's TLS
+// blocks, keyed by "namespace/name". For an Ingress that opts into
+// auto-TLS (see IsAutoTLSEnabled), a missing Secret falls back to
+// GetCertificateSecret instead of failing hard, since the reconciler is
+// expected to have created that block's Certificate via MakeCertificates
+// ahead of this call; certLister is only ever consulted along that path, so
+// callers that never enable auto-TLS may pass a nil lister.
+func GetSecrets(ing *v1alpha1.Ingress, clusterLocalDefault bool, secretLister corelisters.SecretLister, certLister certlisters.CertificateLister) (map[string]*corev1.Secret, error) {
+	secrets := make(map[string]*corev1.Secret, len(ing.Spec.TLS))
+	for _, tls := range ing.Spec.TLS {
+		secret, err := secretLister.Secrets(tls.SecretNamespace).Get(tls.SecretName)
+		if apierrs.IsNotFound(err) && IsAutoTLSEnabled(ing, clusterLocalDefault) {
+			secret, err = GetCertificateSecret(tls, secretLister, certLister)
+		} else if err != nil {
+			err = fmt.Errorf("failed to get Secret: %w", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		secrets[fmt.Sprintf("%s/%s", tls.SecretNamespace, tls.SecretName)] = secret
+	}
+	return secrets, nil
+}
+
+// CategorizeSecrets splits the given secrets into those that back a
+// wildcard host and those that back a non-wildcard host. It only ever sees
+// the leaf-cert Secrets returned by GetSecrets, never a CA trust bundle
+// (see GetTrustBundle), which is resolved and attached separately.
+func CategorizeSecrets(secrets map[string]*corev1.Secret) (nonWildcard map[string]*corev1.Secret, wildcard map[string]*corev1.Secret, err error) {
+	nonWildcard = map[string]*corev1.Secret{}
+	wildcard = map[string]*corev1.Secret{}
+	for key, secret := range secrets {
+		hosts, err := GetHostsFromCertSecret(secret)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isWildcardHosts(hosts) {
+			wildcard[key] = secret
+		} else {
+			nonWildcard[key] = secret
+		}
+	}
+	return nonWildcard, wildcard, nil
+}
+
+func isWildcardHosts(hosts []string) bool {
+	for _, h := range hosts {
+		if strings.HasPrefix(h, "*.") {
+			return true
+		}
+	}
+	return false
+}
+
+// GetHostsFromCertSecret returns the DNS names that the TLS certificate
+// stored in the given Secret was issued for.
+func GetHostsFromCertSecret(secret *corev1.Secret) ([]string, error) {
+	block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block from Secret %s/%s", secret.Namespace, secret.Name)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate from Secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return cert.DNSNames, nil
+}
+
+// TargetSecret returns the name to use for the copy of originSecret that
+// backs the given Ingress in the Istio gateway's namespace.
+func TargetSecret(originSecret *corev1.Secret, ing *v1alpha1.Ingress) string {
+	return fmt.Sprintf("%s-%s", ing.Name, originSecret.UID)
+}
+
+// targetWildcardSecretName returns a stable, DNS1123-safe name for the copy
+// of a wildcard-cert Secret, derived from its origin namespace/name so the
+// same copy can be shared by every Ingress that needs it.
+func targetWildcardSecretName(name, namespace string) string {
+	sum := sha256.Sum256([]byte(namespace + "/" + name))
+	return fmt.Sprintf("wildcard-cert-%s", hex.EncodeToString(sum[:])[:16])
+}
+
+// MakeSecrets returns the Secrets that need to be created (or updated) for
+// each cluster that should carry a copy of originSecrets, so the Istio
+// gateway in that cluster can mount them. The local cluster's secrets are
+// returned under the LocalCluster key, skipping any origin Secret that
+// already lives in the gateway's namespace; any cluster registered with the
+// multicluster secret controller gets its own entry keyed by cluster name,
+// with a copy of every origin Secret regardless of where it happens to live
+// locally, since a remote cluster never has the origin Secret to begin with.
+//
+// When caCert is non-empty (see GetTrustBundle), it is merged into every
+// copy under the caSecretDataKey entry, alongside the leaf cert/key copied
+// from origin, following Istio's generic SDS Secret format; this lets the
+// gateway's SDS agent enable mTLS origination for the Server MakeTLSServers
+// switches to MUTUAL mode, without net-istio ever writing the bundle to a
+// file on the gateway's filesystem.
+func MakeSecrets(ctx context.Context, originSecrets map[string]*corev1.Secret, ing *v1alpha1.Ingress, caCert []byte) (map[string][]*corev1.Secret, error) {
+	cfg := config.FromContext(ctx)
+	if secretDeliveryMode(cfg) == config.SecretDeliveryModeSDS {
+		// The Gateway Servers reference the origin Secrets directly via
+		// SDS (see MakeTLSServers), so there is nothing to copy.
+		return map[string][]*corev1.Secret{}, nil
+	}
+
+	targetNs, err := gatewayServiceNamespace(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	nameFor := func(origin *corev1.Secret) string { return TargetSecret(origin, ing) }
+
+	local := make([]*corev1.Secret, 0, len(originSecrets))
+	for _, origin := range originSecrets {
+		if origin.Namespace == targetNs {
+			// The origin Secret is already where the gateway expects it.
+			continue
+		}
+		local = append(local, targetSecretFor(origin, targetNs, nameFor(origin), caCert))
+	}
+
+	result := map[string][]*corev1.Secret{LocalCluster: local}
+	for _, clusterName := range remoteClusters(ctx) {
+		result[clusterName] = secretsForRemote(originSecrets, targetNs, nameFor, caCert)
+	}
+	return result, nil
+}
+
+// MakeWildcardSecrets behaves like MakeSecrets, but for the Secrets backing
+// wildcard hosts: the copy is named deterministically (rather than per
+// Ingress) so that it can be shared by every Ingress that references the
+// same wildcard certificate.
+func MakeWildcardSecrets(ctx context.Context, originSecrets map[string]*corev1.Secret, caCert []byte) (map[string][]*corev1.Secret, error) {
+	cfg := config.FromContext(ctx)
+	if secretDeliveryMode(cfg) == config.SecretDeliveryModeSDS {
+		// The Gateway Servers reference the origin Secrets directly via
+		// SDS (see MakeTLSServers), so there is nothing to copy.
+		return map[string][]*corev1.Secret{}, nil
+	}
+
+	targetNs, err := gatewayServiceNamespace(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	nameFor := func(origin *corev1.Secret) string {
+		return targetWildcardSecretName(origin.Name, origin.Namespace)
+	}
+
+	local := make([]*corev1.Secret, 0, len(originSecrets))
+	for _, origin := range originSecrets {
+		if origin.Namespace == targetNs {
+			continue
+		}
+		local = append(local, targetSecretFor(origin, targetNs, nameFor(origin), caCert))
+	}
+
+	result := map[string][]*corev1.Secret{LocalCluster: local}
+	for _, clusterName := range remoteClusters(ctx) {
+		result[clusterName] = secretsForRemote(originSecrets, targetNs, nameFor, caCert)
+	}
+	return result, nil
+}
+
+// secretsForRemote builds the copy of every origin Secret that a remote
+// cluster needs, independent of the local-namespace-equality skip that
+// MakeSecrets/MakeWildcardSecrets apply to the local cluster: a remote
+// cluster never has the origin Secret to begin with, so it needs its own
+// copy regardless of which namespace the origin happens to live in locally.
+func secretsForRemote(originSecrets map[string]*corev1.Secret, targetNs string, nameFor func(*corev1.Secret) string, caCert []byte) []*corev1.Secret {
+	secrets := make([]*corev1.Secret, 0, len(originSecrets))
+	for _, origin := range originSecrets {
+		secrets = append(secrets, targetSecretFor(origin, targetNs, nameFor(origin), caCert))
+	}
+	return secrets
+}
+
+// caSecretDataKey is the key under which a copied Secret's CA trust bundle
+// is stored, following the generic Secret format Istio's SDS agent expects
+// (tls.crt, tls.key, cacert) so a MUTUAL mode Server can validate client
+// certs without a separate file-mounted CA.
+const caSecretDataKey = "cacert"
+
+func targetSecretFor(origin *corev1.Secret, targetNamespace, targetName string, caCert []byte) *corev1.Secret {
+	data := origin.Data
+	if len(caCert) > 0 {
+		data = make(map[string][]byte, len(origin.Data)+1)
+		for k, v := range origin.Data {
+			data[k] = v
+		}
+		data[caSecretDataKey] = caCert
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      targetName,
+			Namespace: targetNamespace,
+			Labels: map[string]string{
+				networking.OriginSecretNameLabelKey:      origin.Name,
+				networking.OriginSecretNamespaceLabelKey: origin.Namespace,
+			},
+		},
+		Data: data,
+	}
+}
+
+// remoteClusters returns the names of every remote cluster MakeSecrets and
+// MakeWildcardSecrets should fan out to, preferring a *multicluster.Store
+// stashed in ctx (see multicluster.ToContext) and falling back to the
+// process-wide Store from multicluster.Get() when ctx carries none, which
+// is the case everywhere today since no reconciler in this repo calls
+// multicluster.ToContext yet.
+func remoteClusters(ctx context.Context) []string {
+	if store := multicluster.FromContext(ctx); store != nil {
+		return store.Clusters()
+	}
+	return multicluster.Get().Clusters()
+}
+
+// secretDeliveryMode returns the configured SecretDeliveryMode, defaulting
+// to SecretDeliveryModeCopy when unset.
+func secretDeliveryMode(cfg *config.Config) config.SecretDeliveryMode {
+	if cfg == nil || cfg.Istio == nil || cfg.Istio.SecretDeliveryMode == "" {
+		return config.SecretDeliveryModeCopy
+	}
+	return cfg.Istio.SecretDeliveryMode
+}
+
+// gatewayServiceNamespace returns the namespace the configured Istio
+// ingress gateway Service lives in, which is where secret copies need to
+// be created so the gateway proxy can mount them.
+func gatewayServiceNamespace(cfg *config.Config) (string, error) {
+	if cfg == nil || cfg.Istio == nil || len(cfg.Istio.IngressGateways) == 0 {
+		return "", fmt.Errorf("no Istio ingress gateway configured")
+	}
+	parts := strings.SplitN(cfg.Istio.IngressGateways[0].ServiceURL, ".", 3)
+	if len(parts) < 2 {
+		return "", fmt.Errorf("failed to parse namespace from gateway service URL %q", cfg.Istio.IngressGateways[0].ServiceURL)
+	}
+	return parts[1], nil
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package resources
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -28,11 +30,24 @@ import (
 	kubeinformers "k8s.io/client-go/informers"
 	fakek8s "k8s.io/client-go/kubernetes/fake"
 	"knative.dev/net-istio/pkg/reconciler/ingress/config"
+	"knative.dev/net-istio/pkg/reconciler/ingress/multicluster"
+	"knative.dev/pkg/apis"
 	. "knative.dev/pkg/logging/testing"
 	"knative.dev/serving/pkg/apis/networking"
 	"knative.dev/serving/pkg/apis/networking/v1alpha1"
+	fakeservingclient "knative.dev/serving/pkg/client/clientset/versioned/fake"
+	servinginformers "knative.dev/serving/pkg/client/informers/externalversions"
 )
 
+// contextWithFakeRemoteCluster attaches a Store carrying a single fake
+// remote cluster to ctx, so MakeSecrets/MakeWildcardSecrets fan out to it
+// alongside the local cluster without touching the process-wide Store.
+func contextWithFakeRemoteCluster(ctx context.Context, name string) context.Context {
+	store := multicluster.NewStore()
+	store.Add(multicluster.NewRemoteCluster(name, fakek8s.NewSimpleClientset(), kubeinformers.NewSharedInformerFactory(fakek8s.NewSimpleClientset(), 0)))
+	return multicluster.ToContext(ctx, store)
+}
+
 var (
 	testSecret = corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -100,7 +115,7 @@ func TestGetSecrets(t *testing.T) {
 	for _, c := range cases {
 		createSecret(c.secret)
 		t.Run(c.name, func(t *testing.T) {
-			secrets, err := GetSecrets(c.ci, secretClient.Lister())
+			secrets, err := GetSecrets(c.ci, false, secretClient.Lister(), nil)
 			if (err != nil) != c.wantErr {
 				t.Fatalf("Test: %s; GetSecrets error = %v, WantErr %v", c.name, err, c.wantErr)
 			}
@@ -111,22 +126,72 @@ func TestGetSecrets(t *testing.T) {
 	}
 }
 
-func TestMakeSecrets(t *testing.T) {
-	ctx := TestContextWithLogger(t)
-	ctx = config.ToContext(ctx, &config.Config{
-		Istio: &config.Istio{
-			IngressGateways: []config.Gateway{{
-				Name: "test-gateway",
-				// The namespace of Istio gateway service is istio-system.
-				ServiceURL: "istio-ingressgateway.istio-system.svc.cluster.local",
+func TestGetSecretsAutoTLSFallback(t *testing.T) {
+	// The Secret doesn't exist yet; the Certificate backing it is still
+	// provisioning. Whether GetSecrets falls back to GetCertificateSecret
+	// shows up in which error it returns: *CertificateNotReadyError only
+	// when auto-TLS routed it through the Certificate.
+	kubeClient := fakek8s.NewSimpleClientset()
+	secretClient := kubeinformers.NewSharedInformerFactory(kubeClient, 0).Core().V1().Secrets()
+
+	pendingCert := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-com", Namespace: "knative-serving"},
+		Spec:       v1alpha1.CertificateSpec{DNSNames: []string{"example.com"}, SecretName: "example-com"},
+		Status:     certStatusWithReady(apis.ConditionUnknown, "Provisioning", "still provisioning"),
+	}
+	servingClient := fakeservingclient.NewSimpleClientset()
+	certClient := servinginformers.NewSharedInformerFactory(servingClient, 0).Networking().V1alpha1().Certificates()
+	certClient.Informer().GetIndexer().Add(pendingCert)
+
+	autoTLSIngress := &v1alpha1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ingress",
+			Namespace:   system.Namespace(),
+			Annotations: map[string]string{AutoTLSAnnotationKey: enabledValue},
+		},
+		Spec: v1alpha1.IngressSpec{
+			TLS: []v1alpha1.IngressTLS{{
+				Hosts:           []string{"example.com"},
+				SecretName:      "example-com",
+				SecretNamespace: "knative-serving",
 			}},
 		},
-	})
+	}
+
+	_, err := GetSecrets(autoTLSIngress, false, secretClient.Lister(), certClient.Lister())
+	var notReady *CertificateNotReadyError
+	if !errors.As(err, &notReady) {
+		t.Errorf("GetSecrets() error = %v, want *CertificateNotReadyError", err)
+	}
+
+	nonAutoTLSIngress := autoTLSIngress.DeepCopy()
+	nonAutoTLSIngress.Annotations = nil
+	_, err = GetSecrets(nonAutoTLSIngress, false, secretClient.Lister(), certClient.Lister())
+	if err == nil || errors.As(err, &notReady) {
+		t.Errorf("GetSecrets() error = %v, want a plain \"failed to get Secret\" error since auto-TLS is disabled", err)
+	}
+}
+
+func TestMakeSecrets(t *testing.T) {
+	newCtx := func(mode config.SecretDeliveryMode) context.Context {
+		ctx := TestContextWithLogger(t)
+		return config.ToContext(ctx, &config.Config{
+			Istio: &config.Istio{
+				IngressGateways: []config.Gateway{{
+					Name: "test-gateway",
+					// The namespace of Istio gateway service is istio-system.
+					ServiceURL: "istio-ingressgateway.istio-system.svc.cluster.local",
+				}},
+				SecretDeliveryMode: mode,
+			},
+		})
+	}
 
 	cases := []struct {
 		name         string
+		mode         config.SecretDeliveryMode
 		originSecret *corev1.Secret
-		expected     []*corev1.Secret
+		expected     map[string][]*corev1.Secret
 		wantErr      bool
 	}{{
 		name: "target secret namespace (istio-system) is the same as the origin secret namespace (istio-system).",
@@ -139,7 +204,7 @@ func TestMakeSecrets(t *testing.T) {
 			Data: map[string][]byte{
 				"test-data": []byte("abcd"),
 			}},
-		expected: []*corev1.Secret{},
+		expected: map[string][]*corev1.Secret{LocalCluster: {}},
 	}, {
 		name: "target secret namespace (istio-system) is different from the origin secret namespace (knative-serving).",
 		originSecret: &corev1.Secret{
@@ -151,7 +216,7 @@ func TestMakeSecrets(t *testing.T) {
 			Data: map[string][]byte{
 				"test-data": []byte("abcd"),
 			}},
-		expected: []*corev1.Secret{{
+		expected: map[string][]*corev1.Secret{LocalCluster: {{
 			ObjectMeta: metav1.ObjectMeta{
 				// Name is generated by TargetSecret function.
 				Name: "ingress-1234",
@@ -166,14 +231,29 @@ func TestMakeSecrets(t *testing.T) {
 			Data: map[string][]byte{
 				"test-data": []byte("abcd"),
 			},
-		}},
+		}}},
+	}, {
+		name: "sds delivery mode never copies the Secret",
+		mode: config.SecretDeliveryModeSDS,
+		originSecret: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-secret",
+				Namespace: "knative-serving",
+				UID:       "1234",
+			},
+			Data: map[string][]byte{
+				"test-data": []byte("abcd"),
+			}},
+		expected: map[string][]*corev1.Secret{},
 	}}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			originSecrets := map[string]*corev1.Secret{
 				fmt.Sprintf("%s/%s", c.originSecret.Namespace, c.originSecret.Name): c.originSecret,
 			}
-			secrets, err := MakeSecrets(ctx, originSecrets, &ci)
+			// No remote clusters are registered in this test, so
+			// MakeSecrets should only ever return the LocalCluster entry.
+			secrets, err := MakeSecrets(newCtx(c.mode), originSecrets, &ci, nil)
 			if (err != nil) != c.wantErr {
 				t.Fatalf("Test: %q; MakeSecrets() error = %v, WantErr %v", c.name, err, c.wantErr)
 			}
@@ -184,22 +264,110 @@ func TestMakeSecrets(t *testing.T) {
 	}
 }
 
-func TestMakeWildcardSecrets(t *testing.T) {
-	ctx := TestContextWithLogger(t)
-	ctx = config.ToContext(ctx, &config.Config{
+func TestMakeSecretsRemoteClusters(t *testing.T) {
+	ctx := config.ToContext(TestContextWithLogger(t), &config.Config{
+		Istio: &config.Istio{
+			IngressGateways: []config.Gateway{{
+				Name:       "test-gateway",
+				ServiceURL: "istio-ingressgateway.istio-system.svc.cluster.local",
+			}},
+		},
+	})
+	ctx = contextWithFakeRemoteCluster(ctx, "remote-1")
+
+	// The origin Secret already lives in the local gateway's namespace, so
+	// LocalCluster gets no copy, but the remote cluster still needs its
+	// own, since it never had the origin Secret to begin with.
+	originSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-secret",
+			Namespace: "istio-system",
+			UID:       "1234",
+		},
+		Data: map[string][]byte{"test-data": []byte("abcd")},
+	}
+	originSecrets := map[string]*corev1.Secret{"istio-system/test-secret": originSecret}
+
+	want := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1234",
+			Namespace: "istio-system",
+			Labels: map[string]string{
+				networking.OriginSecretNameLabelKey:      "test-secret",
+				networking.OriginSecretNamespaceLabelKey: "istio-system",
+			},
+		},
+		Data: map[string][]byte{"test-data": []byte("abcd")},
+	}
+
+	secrets, err := MakeSecrets(ctx, originSecrets, &ci, nil)
+	if err != nil {
+		t.Fatalf("MakeSecrets() = %v", err)
+	}
+	if len(secrets[LocalCluster]) != 0 {
+		t.Errorf("secrets[LocalCluster] = %v, want empty", secrets[LocalCluster])
+	}
+	if diff := cmp.Diff([]*corev1.Secret{want}, secrets["remote-1"]); diff != "" {
+		t.Errorf("Unexpected secrets[remote-1] (-want, +got): %s", diff)
+	}
+}
+
+func TestMakeSecretsWithCABundle(t *testing.T) {
+	ctx := config.ToContext(TestContextWithLogger(t), &config.Config{
 		Istio: &config.Istio{
 			IngressGateways: []config.Gateway{{
-				Name: "test-gateway",
-				// The namespace of Istio gateway service is istio-system.
+				Name:       "test-gateway",
 				ServiceURL: "istio-ingressgateway.istio-system.svc.cluster.local",
 			}},
 		},
 	})
 
+	originSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-secret",
+			Namespace: "knative-serving",
+			UID:       "1234",
+		},
+		Data: map[string][]byte{"test-data": []byte("abcd")},
+	}
+	originSecrets := map[string]*corev1.Secret{"knative-serving/test-secret": originSecret}
+
+	secrets, err := MakeSecrets(ctx, originSecrets, &ci, []byte("fake-ca-cert-pem"))
+	if err != nil {
+		t.Fatalf("MakeSecrets() = %v", err)
+	}
+	want := map[string][]byte{
+		"test-data":     []byte("abcd"),
+		caSecretDataKey: []byte("fake-ca-cert-pem"),
+	}
+	if len(secrets[LocalCluster]) != 1 {
+		t.Fatalf("secrets[LocalCluster] = %v, want 1 Secret", secrets[LocalCluster])
+	}
+	if diff := cmp.Diff(want, secrets[LocalCluster][0].Data); diff != "" {
+		t.Errorf("Unexpected Secret Data (-want, +got): %s", diff)
+	}
+}
+
+func TestMakeWildcardSecrets(t *testing.T) {
+	newCtx := func(mode config.SecretDeliveryMode) context.Context {
+		ctx := TestContextWithLogger(t)
+		return config.ToContext(ctx, &config.Config{
+			Istio: &config.Istio{
+				IngressGateways: []config.Gateway{{
+					Name: "test-gateway",
+					// The namespace of Istio gateway service is istio-system.
+					ServiceURL: "istio-ingressgateway.istio-system.svc.cluster.local",
+				}},
+				SecretDeliveryMode: mode,
+			},
+		})
+	}
+
 	cases := []struct {
 		name         string
+		mode         config.SecretDeliveryMode
 		originSecret *corev1.Secret
-		expected     []*corev1.Secret
+		expected     map[string][]*corev1.Secret
 		wantErr      bool
 	}{{
 		name: "target secret namespace (istio-system) is the same as the origin secret namespace (istio-system).",
@@ -212,7 +380,7 @@ func TestMakeWildcardSecrets(t *testing.T) {
 			Data: map[string][]byte{
 				"test-data": []byte("abcd"),
 			}},
-		expected: []*corev1.Secret{},
+		expected: map[string][]*corev1.Secret{LocalCluster: {}},
 	}, {
 		name: "target secret namespace (istio-system) is different from the origin secret namespace (knative-serving).",
 		originSecret: &corev1.Secret{
@@ -224,25 +392,43 @@ func TestMakeWildcardSecrets(t *testing.T) {
 			Data: map[string][]byte{
 				"test-data": []byte("abcd"),
 			}},
-		expected: []*corev1.Secret{{
+		expected: map[string][]*corev1.Secret{LocalCluster: {{
 			ObjectMeta: metav1.ObjectMeta{
 				Name: targetWildcardSecretName("test-secret", "knative-serving"),
 				// Expected secret should be in istio-system which is
 				// the ns of Istio gateway service.
 				Namespace: "istio-system",
-				Labels:    map[string]string{},
+				Labels: map[string]string{
+					networking.OriginSecretNameLabelKey:      "test-secret",
+					networking.OriginSecretNamespaceLabelKey: "knative-serving",
+				},
 			},
 			Data: map[string][]byte{
 				"test-data": []byte("abcd"),
 			},
-		}},
+		}}},
+	}, {
+		name: "sds delivery mode never copies the Secret",
+		mode: config.SecretDeliveryModeSDS,
+		originSecret: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-secret",
+				Namespace: "knative-serving",
+				UID:       "1234",
+			},
+			Data: map[string][]byte{
+				"test-data": []byte("abcd"),
+			}},
+		expected: map[string][]*corev1.Secret{},
 	}}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			originSecrets := map[string]*corev1.Secret{
 				fmt.Sprintf("%s/%s", c.originSecret.Namespace, c.originSecret.Name): c.originSecret,
 			}
-			secrets, err := MakeWildcardSecrets(ctx, originSecrets)
+			// No remote clusters are registered in this test, so
+			// MakeWildcardSecrets should only ever return the LocalCluster entry.
+			secrets, err := MakeWildcardSecrets(newCtx(c.mode), originSecrets, nil)
 			if (err != nil) != c.wantErr {
 				t.Fatalf("Test: %q; MakeWildcardSecrets() error = %v, WantErr %v", c.name, err, c.wantErr)
 			}
@@ -253,6 +439,51 @@ func TestMakeWildcardSecrets(t *testing.T) {
 	}
 }
 
+func TestMakeWildcardSecretsRemoteClusters(t *testing.T) {
+	ctx := config.ToContext(TestContextWithLogger(t), &config.Config{
+		Istio: &config.Istio{
+			IngressGateways: []config.Gateway{{
+				Name:       "test-gateway",
+				ServiceURL: "istio-ingressgateway.istio-system.svc.cluster.local",
+			}},
+		},
+	})
+	ctx = contextWithFakeRemoteCluster(ctx, "remote-1")
+
+	originSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-secret",
+			Namespace: "istio-system",
+			UID:       "1234",
+		},
+		Data: map[string][]byte{"test-data": []byte("abcd")},
+	}
+	originSecrets := map[string]*corev1.Secret{"istio-system/test-secret": originSecret}
+
+	want := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      targetWildcardSecretName("test-secret", "istio-system"),
+			Namespace: "istio-system",
+			Labels: map[string]string{
+				networking.OriginSecretNameLabelKey:      "test-secret",
+				networking.OriginSecretNamespaceLabelKey: "istio-system",
+			},
+		},
+		Data: map[string][]byte{"test-data": []byte("abcd")},
+	}
+
+	secrets, err := MakeWildcardSecrets(ctx, originSecrets, nil)
+	if err != nil {
+		t.Fatalf("MakeWildcardSecrets() = %v", err)
+	}
+	if len(secrets[LocalCluster]) != 0 {
+		t.Errorf("secrets[LocalCluster] = %v, want empty", secrets[LocalCluster])
+	}
+	if diff := cmp.Diff([]*corev1.Secret{want}, secrets["remote-1"]); diff != "" {
+		t.Errorf("Unexpected secrets[remote-1] (-want, +got): %s", diff)
+	}
+}
+
 func TestCategorizeSecrets(t *testing.T) {
 	cases := []struct {
 		name            string
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"encoding/pem"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"knative.dev/net-istio/pkg/reconciler/ingress/config"
+	"knative.dev/serving/pkg/apis/networking/v1alpha1"
+)
+
+const (
+	// CABundleSecretAnnotationKey overrides config.Istio's CASecretName for
+	// a single Ingress.
+	CABundleSecretAnnotationKey = "networking.knative.dev/ca-secret-name"
+
+	// CABundleConfigMapAnnotationKey overrides config.Istio's
+	// CAConfigMapName for a single Ingress.
+	CABundleConfigMapAnnotationKey = "networking.knative.dev/ca-configmap-name"
+
+	// caBundleDataKey is the key under which the CA trust bundle's PEM
+	// data lives in both the Secret and ConfigMap sources.
+	caBundleDataKey = "ca.crt"
+)
+
+// GetTrustBundle resolves the CA trust bundle configured for ing, either
+// through its per-Ingress annotations or the cluster-wide config.Istio
+// defaults, and returns its PEM-encoded contents. It returns (nil, nil) when
+// no CA source is configured, since a trust bundle is optional.
+func GetTrustBundle(ing *v1alpha1.Ingress, istioCfg *config.Istio, secretLister corelisters.SecretLister, configMapLister corelisters.ConfigMapLister) ([]byte, error) {
+	ns := ing.Namespace
+
+	if name := caSecretName(ing, istioCfg); name != "" {
+		secret, err := secretLister.Secrets(ns).Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get CA trust bundle Secret %s/%s: %w", ns, name, err)
+		}
+		return GetCAFromTrustBundle(secret.Data)
+	}
+
+	if name := caConfigMapName(ing, istioCfg); name != "" {
+		configMap, err := configMapLister.ConfigMaps(ns).Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get CA trust bundle ConfigMap %s/%s: %w", ns, name, err)
+		}
+		data := make(map[string][]byte, len(configMap.Data))
+		for k, v := range configMap.Data {
+			data[k] = []byte(v)
+		}
+		return GetCAFromTrustBundle(data)
+	}
+
+	return nil, nil
+}
+
+// GetCAFromTrustBundle PEM-decodes the ca.crt entry of a CA trust bundle,
+// validating that it actually contains certificate material, and returns
+// its raw PEM bytes, which MakeSecrets merges into the copied Secrets under
+// caSecretDataKey.
+func GetCAFromTrustBundle(data map[string][]byte) ([]byte, error) {
+	caCert, ok := data[caBundleDataKey]
+	if !ok {
+		return nil, fmt.Errorf("trust bundle is missing the %q entry", caBundleDataKey)
+	}
+	if block, _ := pem.Decode(caCert); block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block from trust bundle %q entry", caBundleDataKey)
+	}
+	return caCert, nil
+}
+
+func caSecretName(ing *v1alpha1.Ingress, istioCfg *config.Istio) string {
+	if name := ing.Annotations[CABundleSecretAnnotationKey]; name != "" {
+		return name
+	}
+	if istioCfg != nil {
+		return istioCfg.CASecretName
+	}
+	return ""
+}
+
+func caConfigMapName(ing *v1alpha1.Ingress, istioCfg *config.Istio) string {
+	if name := ing.Annotations[CABundleConfigMapAnnotationKey]; name != "" {
+		return name
+	}
+	if istioCfg != nil {
+		return istioCfg.CAConfigMapName
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakek8s "k8s.io/client-go/kubernetes/fake"
+	"knative.dev/net-istio/pkg/reconciler/ingress/config"
+	"knative.dev/serving/pkg/apis/networking/v1alpha1"
+)
+
+var fakeCACert = []byte(`-----BEGIN CERTIFICATE-----
+ZmFrZS1jYS1jZXJ0
+-----END CERTIFICATE-----
+`)
+
+func TestGetTrustBundle(t *testing.T) {
+	kubeClient := fakek8s.NewSimpleClientset()
+	factory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	secretClient := factory.Core().V1().Secrets()
+	configMapClient := factory.Core().V1().ConfigMaps()
+
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ca-secret", Namespace: "knative-serving"},
+		Data:       map[string][]byte{"ca.crt": fakeCACert},
+	}
+	secretClient.Informer().GetIndexer().Add(caSecret)
+
+	caConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ca-configmap", Namespace: "knative-serving"},
+		Data:       map[string]string{"ca.crt": string(fakeCACert)},
+	}
+	configMapClient.Informer().GetIndexer().Add(caConfigMap)
+
+	ing := &v1alpha1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "knative-serving"}}
+
+	cases := []struct {
+		name     string
+		istioCfg *config.Istio
+		wantErr  bool
+	}{{
+		name:     "no CA source configured",
+		istioCfg: &config.Istio{},
+	}, {
+		name:     "Secret-sourced CA bundle",
+		istioCfg: &config.Istio{CASecretName: "ca-secret"},
+	}, {
+		name:     "ConfigMap-sourced CA bundle",
+		istioCfg: &config.Istio{CAConfigMapName: "ca-configmap"},
+	}, {
+		name:     "missing Secret",
+		istioCfg: &config.Istio{CASecretName: "no-such-secret"},
+		wantErr:  true,
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := GetTrustBundle(ing, c.istioCfg, secretClient.Lister(), configMapClient.Lister())
+			if (err != nil) != c.wantErr {
+				t.Fatalf("GetTrustBundle() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if c.wantErr {
+				return
+			}
+			var want []byte
+			if c.istioCfg.CASecretName != "" || c.istioCfg.CAConfigMapName != "" {
+				want = fakeCACert
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Unexpected trust bundle (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestGetCAFromTrustBundle(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    map[string][]byte
+		wantErr bool
+	}{{
+		name: "valid bundle",
+		data: map[string][]byte{"ca.crt": fakeCACert},
+	}, {
+		name:    "missing ca.crt",
+		data:    map[string][]byte{"other": fakeCACert},
+		wantErr: true,
+	}, {
+		name:    "invalid PEM",
+		data:    map[string][]byte{"ca.crt": []byte("not-pem")},
+		wantErr: true,
+	}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := GetCAFromTrustBundle(c.data)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("GetCAFromTrustBundle() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if !c.wantErr && string(got) != string(fakeCACert) {
+				t.Errorf("GetCAFromTrustBundle() = %q, want %q", got, fakeCACert)
+			}
+		})
+	}
+}